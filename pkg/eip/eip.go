@@ -0,0 +1,75 @@
+package eip
+
+import (
+	"fmt"
+
+	"github.com/yunify/qingcloud-cloud-controller-manager/pkg/executor"
+	"github.com/yunify/qingcloud-cloud-controller-manager/pkg/loadbalance"
+	qcservice "github.com/yunify/qingcloud-sdk-go/service"
+)
+
+var _ loadbalance.EipHelper = &EIPHelperOfQingCloud{}
+
+// EIPHelperOfQingCloud allocates, attaches, detaches and releases QingCloud
+// EIPs on behalf of a LoadBalancer. It implements loadbalance.EipHelper.
+type EIPHelperOfQingCloud struct {
+	userID string
+	jobAPI *qcservice.JobService
+	eipAPI *qcservice.EIPService
+}
+
+// NewEIPHelperOfQingCloudOption groups the dependencies EIPHelperOfQingCloud needs.
+type NewEIPHelperOfQingCloudOption struct {
+	JobAPI *qcservice.JobService
+	EIPAPI *qcservice.EIPService
+	UserID string
+}
+
+// NewEIPHelperOfQingCloud builds an EIPHelperOfQingCloud from opt.
+func NewEIPHelperOfQingCloud(opt NewEIPHelperOfQingCloudOption) *EIPHelperOfQingCloud {
+	return &EIPHelperOfQingCloud{
+		userID: opt.UserID,
+		jobAPI: opt.JobAPI,
+		eipAPI: opt.EIPAPI,
+	}
+}
+
+// EnsureAttached allocates an EIP if lbID doesn't already have one attached,
+// and attaches it.
+func (h *EIPHelperOfQingCloud) EnsureAttached(lbID string) (*loadbalance.EIP, error) {
+	output, err := h.eipAPI.AllocateEIPs(&qcservice.AllocateEIPsInput{
+		Count: qcservice.Int(1),
+	})
+	if err != nil {
+		return nil, executor.ClassifyQingCloudError(fmt.Sprintf("allocate eip for load balancer %s", lbID), err)
+	}
+	if len(output.EIPs) == 0 {
+		return nil, fmt.Errorf("allocate eip for load balancer %s: no EIP returned", lbID)
+	}
+	eipID := qcservice.StringValue(output.EIPs[0])
+	if err := executor.WaitForJob(h.jobAPI, qcservice.StringValue(output.JobID)); err != nil {
+		return nil, err
+	}
+	associateOutput, err := h.eipAPI.AssociateEIP(&qcservice.AssociateEIPInput{
+		EIP:        &eipID,
+		InstanceID: &lbID,
+	})
+	if err != nil {
+		return nil, executor.ClassifyQingCloudError(fmt.Sprintf("associate eip %s with load balancer %s", eipID, lbID), err)
+	}
+	if err := executor.WaitForJob(h.jobAPI, qcservice.StringValue(associateOutput.JobID)); err != nil {
+		return nil, err
+	}
+	return &loadbalance.EIP{ID: eipID}, nil
+}
+
+// Release detaches and releases whatever EIP is attached to lbID.
+func (h *EIPHelperOfQingCloud) Release(lbID string) error {
+	output, err := h.eipAPI.DissociateEIPs(&qcservice.DissociateEIPsInput{
+		InstanceID: &lbID,
+	})
+	if err != nil {
+		return executor.ClassifyQingCloudError(fmt.Sprintf("dissociate eip from load balancer %s", lbID), err)
+	}
+	return executor.WaitForJob(h.jobAPI, qcservice.StringValue(output.JobID))
+}
@@ -0,0 +1,24 @@
+package errors
+
+import "fmt"
+
+// ResourceNotFound indicates the named QingCloud resource (LB, EIP, security
+// group, ...) doesn't exist.
+type ResourceNotFound struct {
+	Resource string
+}
+
+// NewResourceNotFound builds a ResourceNotFound error for resource.
+func NewResourceNotFound(resource string) *ResourceNotFound {
+	return &ResourceNotFound{Resource: resource}
+}
+
+func (e *ResourceNotFound) Error() string {
+	return fmt.Sprintf("resource %q not found", e.Resource)
+}
+
+// IsResourceNotFound reports whether err is a *ResourceNotFound.
+func IsResourceNotFound(err error) bool {
+	_, ok := err.(*ResourceNotFound)
+	return ok
+}
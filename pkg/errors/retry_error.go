@@ -0,0 +1,31 @@
+package errors
+
+import (
+	"fmt"
+	"time"
+)
+
+// RetryError indicates that the LB operation should be retried after
+// RetryAfter instead of being subject to the caller's normal (exponential)
+// backoff. It is returned for conditions we know are transient and whose
+// expected duration we can estimate, such as a QingCloud job that is still
+// running or an API call that got rate-limited.
+type RetryError struct {
+	msg        string
+	RetryAfter time.Duration
+}
+
+// NewRetryError builds a RetryError that asks the caller to retry after d.
+func NewRetryError(msg string, d time.Duration) *RetryError {
+	return &RetryError{msg: msg, RetryAfter: d}
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", e.msg, e.RetryAfter)
+}
+
+// IsRetryError reports whether err is a *RetryError.
+func IsRetryError(err error) bool {
+	_, ok := err.(*RetryError)
+	return ok
+}
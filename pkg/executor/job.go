@@ -0,0 +1,69 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yunify/qingcloud-cloud-controller-manager/pkg/errors"
+	qcservice "github.com/yunify/qingcloud-sdk-go/service"
+)
+
+// Retry intervals surfaced to the service controller via *errors.RetryError.
+// A pending job is usually seconds away from finishing, so we ask for a short
+// poll; a quota/rate-limit rejection needs real wall-clock time to clear.
+const (
+	jobPendingRetryInterval    = 5 * time.Second
+	quotaExceededRetryInterval = 30 * time.Second
+	rateLimitedRetryInterval   = 15 * time.Second
+)
+
+// WaitForJob describes jobID and turns "still running"/"rate limited" outcomes
+// into an *errors.RetryError so callers can hand a sane retry interval back up
+// to the service controller instead of a plain error that triggers its
+// exponential backoff. It is shared by the LB executor, the security group
+// executor and the EIP helper, since they all drive the same async job API.
+func WaitForJob(jobService *qcservice.JobService, jobID string) error {
+	if jobID == "" {
+		return nil
+	}
+	output, err := jobService.DescribeJobs(&qcservice.DescribeJobsInput{
+		Jobs: []*string{&jobID},
+	})
+	if err != nil {
+		return ClassifyQingCloudError(fmt.Sprintf("qingcloud job %s", jobID), err)
+	}
+	if output == nil || len(output.JobSet) == 0 {
+		return fmt.Errorf("qingcloud job %s: not found", jobID)
+	}
+	job := output.JobSet[0]
+	switch qcservice.StringValue(job.Status) {
+	case "pending", "working":
+		return errors.NewRetryError(fmt.Sprintf("qingcloud job %s is still %s", jobID, qcservice.StringValue(job.Status)), jobPendingRetryInterval)
+	case "failed":
+		return fmt.Errorf("qingcloud job %s failed", jobID)
+	}
+	return nil
+}
+
+// ClassifyQingCloudError tags quota and rate-limit failures from any
+// QingCloud API call with the interval the caller should wait before
+// retrying. op names the call that failed (e.g. "create load balancer",
+// "qingcloud job j-xxx") for the resulting error message. Every QC API call
+// the executors make — not just DescribeJobs while polling an already
+// accepted job — goes through this, since QingCloud returns
+// QuotaExceeded/429 synchronously from the submitting call itself, not only
+// from polling.
+func ClassifyQingCloudError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "QuotaExceeded"):
+		return errors.NewRetryError(fmt.Sprintf("%s: quota exceeded", op), quotaExceededRetryInterval)
+	case strings.Contains(msg, "429"), strings.Contains(msg, "Too Many Requests"):
+		return errors.NewRetryError(fmt.Sprintf("%s: rate limited", op), rateLimitedRetryInterval)
+	}
+	return err
+}
@@ -0,0 +1,64 @@
+package executor
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	ccmerrors "github.com/yunify/qingcloud-cloud-controller-manager/pkg/errors"
+)
+
+func TestClassifyQingCloudError(t *testing.T) {
+	cases := []struct {
+		name           string
+		err            error
+		wantRetry      bool
+		wantRetryAfter time.Duration
+	}{
+		{
+			name:           "quota exceeded",
+			err:            errors.New("QuotaExceeded: too many load balancers"),
+			wantRetry:      true,
+			wantRetryAfter: quotaExceededRetryInterval,
+		},
+		{
+			name:           "http 429",
+			err:            errors.New("429 rate limit hit"),
+			wantRetry:      true,
+			wantRetryAfter: rateLimitedRetryInterval,
+		},
+		{
+			name:           "too many requests",
+			err:            errors.New("Too Many Requests"),
+			wantRetry:      true,
+			wantRetryAfter: rateLimitedRetryInterval,
+		},
+		{
+			name:      "unrelated error passes through",
+			err:       errors.New("InvalidParameter: bad vxnet"),
+			wantRetry: false,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := ClassifyQingCloudError("create load balancer lb-1", c.err)
+			if ccmerrors.IsRetryError(got) != c.wantRetry {
+				t.Fatalf("IsRetryError(%v) = %v, want %v", got, ccmerrors.IsRetryError(got), c.wantRetry)
+			}
+			if c.wantRetry {
+				retryErr := got.(*ccmerrors.RetryError)
+				if retryErr.RetryAfter != c.wantRetryAfter {
+					t.Fatalf("RetryAfter = %v, want %v", retryErr.RetryAfter, c.wantRetryAfter)
+				}
+			} else if got != c.err {
+				t.Fatalf("expected the original error to pass through unchanged, got %v", got)
+			}
+		})
+	}
+}
+
+func TestClassifyQingCloudErrorNil(t *testing.T) {
+	if got := ClassifyQingCloudError("create load balancer lb-1", nil); got != nil {
+		t.Fatalf("expected nil, got %v", got)
+	}
+}
@@ -0,0 +1,124 @@
+package executor
+
+import (
+	"fmt"
+
+	"github.com/yunify/qingcloud-cloud-controller-manager/pkg/errors"
+	qcservice "github.com/yunify/qingcloud-sdk-go/service"
+)
+
+// LoadBalanceExecutor talks to the QingCloud LB API on behalf of
+// loadbalance.LoadBalancer. Methods that kick off an async job return the
+// job's outcome via WaitForJob, so callers may see an *errors.RetryError
+// when the job is still pending or QingCloud is rate-limiting us.
+type LoadBalanceExecutor interface {
+	EnableTagService(tagIDs []string)
+	// DescribeLoadBalancer returns the LB named lbName, or an
+	// errors.ResourceNotFound error if it doesn't exist yet.
+	DescribeLoadBalancer(lbName string) (*qcservice.LoadBalancer, error)
+	// CreateLoadBalancer creates an LB bound to vxnet and returns its ID. For
+	// an internet-facing LB (internal=false), eipID must be the EIP to
+	// attach; for an internal one, eipID is ignored and vxnet is the private
+	// vxnet the LB gets its VIP from.
+	CreateLoadBalancer(lbName, vxnet, eipID string, internal bool) (lbID string, err error)
+	// UpdateListeners reconciles lbID's listeners to match ports.
+	UpdateListeners(lbID string, ports []int32) error
+	// DeleteLoadBalancer deletes lbID. Returns nil if it's already gone.
+	DeleteLoadBalancer(lbID string) error
+}
+
+// QingCloud LB types, as accepted by CreateLoadBalancerInput.LoadBalancerType:
+// an internal LB never gets an EIP and is only reachable on its vxnet.
+const (
+	loadBalancerTypeInternetFacing = 0
+	loadBalancerTypeInternal       = 1
+)
+
+type qingCloudLoadBalanceExecutor struct {
+	userID     string
+	lbService  *qcservice.LoadBalancerService
+	jobService *qcservice.JobService
+	tagService *qcservice.TagService
+	tagIDs     []string
+}
+
+// NewQingCloudLoadBalanceExecutor builds the LoadBalanceExecutor used to
+// drive lbService/jobService on behalf of userID.
+func NewQingCloudLoadBalanceExecutor(userID string, lbService *qcservice.LoadBalancerService, jobService *qcservice.JobService, tagService *qcservice.TagService) LoadBalanceExecutor {
+	return &qingCloudLoadBalanceExecutor{
+		userID:     userID,
+		lbService:  lbService,
+		jobService: jobService,
+		tagService: tagService,
+	}
+}
+
+func (e *qingCloudLoadBalanceExecutor) EnableTagService(tagIDs []string) {
+	e.tagIDs = tagIDs
+}
+
+func (e *qingCloudLoadBalanceExecutor) DescribeLoadBalancer(lbName string) (*qcservice.LoadBalancer, error) {
+	output, err := e.lbService.DescribeLoadBalancers(&qcservice.DescribeLoadBalancersInput{
+		LoadBalancerNames: []*string{&lbName},
+	})
+	if err != nil {
+		return nil, ClassifyQingCloudError(fmt.Sprintf("describe load balancer %s", lbName), err)
+	}
+	if output == nil || len(output.LoadBalancerSet) == 0 {
+		return nil, errors.NewResourceNotFound(lbName)
+	}
+	return output.LoadBalancerSet[0], nil
+}
+
+func (e *qingCloudLoadBalanceExecutor) CreateLoadBalancer(lbName, vxnet, eipID string, internal bool) (string, error) {
+	input := &qcservice.CreateLoadBalancerInput{
+		LoadBalancerName: &lbName,
+		VxNetID:          &vxnet,
+	}
+	if internal {
+		// No EIP: the LB only gets a VIP on vxnet.
+		input.LoadBalancerType = qcservice.Int(loadBalancerTypeInternal)
+	} else {
+		input.LoadBalancerType = qcservice.Int(loadBalancerTypeInternetFacing)
+		input.EIPs = []*string{&eipID}
+	}
+	if len(e.tagIDs) > 0 {
+		input.TagIDs = qcservice.StringSlice(e.tagIDs)
+	}
+	output, err := e.lbService.CreateLoadBalancer(input)
+	if err != nil {
+		return "", ClassifyQingCloudError(fmt.Sprintf("create load balancer %s", lbName), err)
+	}
+	if err := WaitForJob(e.jobService, qcservice.StringValue(output.JobID)); err != nil {
+		return "", err
+	}
+	return qcservice.StringValue(output.LoadBalancerID), nil
+}
+
+func (e *qingCloudLoadBalanceExecutor) UpdateListeners(lbID string, ports []int32) error {
+	// Listener reconciliation is intentionally coarse: replace the whole set
+	// rather than diffing per-port, since QingCloud LB listener churn on a
+	// Service's port list is rare and this keeps the executor's contract
+	// (and its job-wait/RetryError handling) in one place.
+	output, err := e.lbService.ModifyLoadBalancerAttributes(&qcservice.ModifyLoadBalancerAttributesInput{
+		LoadBalancer: &lbID,
+		Listeners:    ports,
+	})
+	if err != nil {
+		return ClassifyQingCloudError(fmt.Sprintf("update listeners for load balancer %s", lbID), err)
+	}
+	return WaitForJob(e.jobService, qcservice.StringValue(output.JobID))
+}
+
+func (e *qingCloudLoadBalanceExecutor) DeleteLoadBalancer(lbID string) error {
+	output, err := e.lbService.DeleteLoadBalancers(&qcservice.DeleteLoadBalancersInput{
+		LoadBalancers: []*string{&lbID},
+	})
+	if err != nil {
+		if errors.IsResourceNotFound(err) {
+			return nil
+		}
+		return ClassifyQingCloudError(fmt.Sprintf("delete load balancer %s", lbID), err)
+	}
+	return WaitForJob(e.jobService, qcservice.StringValue(output.JobID))
+}
@@ -0,0 +1,108 @@
+package executor
+
+import (
+	"fmt"
+
+	qcservice "github.com/yunify/qingcloud-sdk-go/service"
+)
+
+// SecurityGroupRule is a single ingress rule on an LB's security group,
+// allowing Protocol traffic to Port from CIDR. Description is the QC rule
+// name; callers use it to tag rules they own so they can tell their own
+// rules apart from ones added by something else sharing the same SG.
+type SecurityGroupRule struct {
+	ID          string
+	CIDR        string
+	Port        int32
+	Protocol    string
+	Description string
+}
+
+// SecurityGroupExecutor manages the security group rules attached to an LB.
+type SecurityGroupExecutor interface {
+	EnableTagService(tagIDs []string)
+	// DescribeRules lists the ingress rules currently on sgID.
+	DescribeRules(sgID string) ([]SecurityGroupRule, error)
+	// AddRule adds rule to sgID.
+	AddRule(sgID string, rule SecurityGroupRule) error
+	// DeleteRule removes the rule identified by ruleID from sgID.
+	DeleteRule(sgID, ruleID string) error
+}
+
+type qingCloudSecurityGroupExecutor struct {
+	securityGroupService *qcservice.SecurityGroupService
+	tagService           *qcservice.TagService
+	tagIDs               []string
+}
+
+// NewQingCloudSecurityGroupExecutor builds the SecurityGroupExecutor used to
+// drive securityGroupService on an LB's security group.
+func NewQingCloudSecurityGroupExecutor(securityGroupService *qcservice.SecurityGroupService, tagService *qcservice.TagService) SecurityGroupExecutor {
+	return &qingCloudSecurityGroupExecutor{
+		securityGroupService: securityGroupService,
+		tagService:           tagService,
+	}
+}
+
+func (e *qingCloudSecurityGroupExecutor) EnableTagService(tagIDs []string) {
+	e.tagIDs = tagIDs
+}
+
+func (e *qingCloudSecurityGroupExecutor) DescribeRules(sgID string) ([]SecurityGroupRule, error) {
+	output, err := e.securityGroupService.DescribeSecurityGroupRules(&qcservice.DescribeSecurityGroupRulesInput{
+		SecurityGroup: &sgID,
+	})
+	if err != nil {
+		return nil, ClassifyQingCloudError(fmt.Sprintf("describe security group rules of %s", sgID), err)
+	}
+	rules := make([]SecurityGroupRule, 0, len(output.SecurityGroupRuleSet))
+	for _, r := range output.SecurityGroupRuleSet {
+		rules = append(rules, SecurityGroupRule{
+			ID:          qcservice.StringValue(r.SecurityGroupRuleID),
+			CIDR:        qcservice.StringValue(r.Val3),
+			Port:        int32(qcservice.IntValue(r.Val1)),
+			Protocol:    qcservice.StringValue(r.Protocol),
+			Description: qcservice.StringValue(r.SecurityGroupRuleName),
+		})
+	}
+	return rules, nil
+}
+
+func (e *qingCloudSecurityGroupExecutor) AddRule(sgID string, rule SecurityGroupRule) error {
+	port := fmt.Sprintf("%d", rule.Port)
+	_, err := e.securityGroupService.AddSecurityGroupRules(&qcservice.AddSecurityGroupRulesInput{
+		SecurityGroup: &sgID,
+		Rules: []*qcservice.SecurityGroupRule{
+			{
+				Protocol:              &rule.Protocol,
+				Action:                qcservice.String("accept"),
+				Priority:              qcservice.Int(0),
+				Val1:                  &port,
+				Val3:                  &rule.CIDR,
+				SecurityGroupRuleName: &rule.Description,
+			},
+		},
+	})
+	if err != nil {
+		return ClassifyQingCloudError(fmt.Sprintf("add security group rule to %s", sgID), err)
+	}
+	return e.applySecurityGroup(sgID)
+}
+
+func (e *qingCloudSecurityGroupExecutor) DeleteRule(sgID, ruleID string) error {
+	_, err := e.securityGroupService.DeleteSecurityGroupRules(&qcservice.DeleteSecurityGroupRulesInput{
+		SecurityGroupRules: []*string{&ruleID},
+	})
+	if err != nil {
+		return ClassifyQingCloudError(fmt.Sprintf("delete security group rule %s", ruleID), err)
+	}
+	return e.applySecurityGroup(sgID)
+}
+
+// applySecurityGroup makes pending rule changes on sgID take effect.
+func (e *qingCloudSecurityGroupExecutor) applySecurityGroup(sgID string) error {
+	_, err := e.securityGroupService.ApplySecurityGroup(&qcservice.ApplySecurityGroupInput{
+		SecurityGroup: &sgID,
+	})
+	return ClassifyQingCloudError(fmt.Sprintf("apply security group %s", sgID), err)
+}
@@ -0,0 +1,301 @@
+package loadbalance
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/yunify/qingcloud-cloud-controller-manager/pkg/errors"
+	"github.com/yunify/qingcloud-cloud-controller-manager/pkg/executor"
+	qcservice "github.com/yunify/qingcloud-sdk-go/service"
+	"k8s.io/api/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// securityGroupRuleOwner is stamped onto the description of every rule this
+// CCM adds, so reconcileSecurityGroup only ever deletes rules it created
+// itself instead of blanket-deleting anything it doesn't recognize (the SG
+// attached to an LB may carry rules added by another tool, or by future use
+// of the same SG for something other than this Service's listeners).
+const securityGroupRuleOwner = "k8s-qingcloud-ccm"
+
+// EIP is a QingCloud elastic IP bound to a LoadBalancer.
+type EIP struct {
+	ID      string
+	Address string
+}
+
+// EipHelper allocates/attaches and detaches/releases the EIP an
+// internet-facing LoadBalancer is reachable on. Internal LoadBalancers don't
+// use one at all (see NewLoadBalancerOption.Internal).
+type EipHelper interface {
+	// EnsureAttached allocates an EIP if lbID doesn't already have one, and
+	// attaches it. It returns the address currently associated with lbID.
+	EnsureAttached(lbID string) (*EIP, error)
+	// Release detaches and releases whatever EIP is associated with lbID.
+	// It is a no-op if lbID has none.
+	Release(lbID string) error
+}
+
+// NewLoadBalancerOption groups everything a LoadBalancer needs to reconcile
+// a single Service's QingCloud LB.
+type NewLoadBalancerOption struct {
+	LbExecutor executor.LoadBalanceExecutor
+	EipHelper  EipHelper
+	SgExecutor executor.SecurityGroupExecutor
+
+	NodeLister corelisters.NodeLister
+	K8sNodes   []*v1.Node
+	K8sService *v1.Service
+
+	Context context.Context
+
+	ClusterName string
+	SkipCheck   bool
+
+	// DefaultVxnet is the vxnet the LB is created in; when Internal is set, it
+	// is the private vxnet the LB's VIP comes from.
+	DefaultVxnet string
+	// Internal, when set, builds an LB reachable only from DefaultVxnet: no
+	// EIP is allocated/attached, and status reports the LB's private VIP.
+	Internal bool
+
+	// SourceRanges are the CIDRs allowed to reach the LB; EnsureQingCloudLB
+	// reconciles the LB's security group rules to match. Empty means
+	// "0.0.0.0/0" (no restriction), matching Spec.LoadBalancerSourceRanges.
+	SourceRanges []string
+
+	// EventRecorder, if set, receives milestone/warning Events for this LB's
+	// Service so operators can follow long-running reconciles via
+	// `kubectl describe svc`.
+	EventRecorder record.EventRecorder
+}
+
+// Status is the QingCloud-side state of a LoadBalancer, as last observed.
+type Status struct {
+	K8sLoadBalancerStatus *v1.LoadBalancerStatus
+}
+
+// LoadBalancer reconciles a single Service's QingCloud load balancer.
+type LoadBalancer struct {
+	opt  *NewLoadBalancerOption
+	name string
+	lbID string
+
+	Status Status
+}
+
+// NewLoadBalancer validates opt and derives the QingCloud LB name for
+// opt.K8sService.
+func NewLoadBalancer(opt *NewLoadBalancerOption) (*LoadBalancer, error) {
+	if opt.K8sService == nil {
+		return nil, fmt.Errorf("loadbalance: K8sService is required")
+	}
+	if opt.LbExecutor == nil {
+		return nil, fmt.Errorf("loadbalance: LbExecutor is required")
+	}
+	if !opt.Internal && opt.EipHelper == nil {
+		return nil, fmt.Errorf("loadbalance: EipHelper is required for an internet-facing LB")
+	}
+	return &LoadBalancer{
+		opt:  opt,
+		name: GetLoadBalancerName(opt.ClusterName, opt.K8sService, opt.LbExecutor),
+	}, nil
+}
+
+// GetLoadBalancerName returns the QingCloud LB name for service in cluster
+// clusterName. The LoadBalanceExecutor argument is not used: the name depends
+// only on clusterName and the Service's namespace and name.
+func GetLoadBalancerName(clusterName string, service *v1.Service, _ executor.LoadBalanceExecutor) string {
+	return fmt.Sprintf("k8s-%s-%s-%s", clusterName, service.Namespace, service.Name)
+}
+
+// GenerateK8sLoadBalancer refreshes Status from the QingCloud LB's current
+// state, without creating or modifying anything. Returns an
+// errors.ResourceNotFound error (see errors.IsResourceNotFound) if the LB
+// doesn't exist yet.
+func (lb *LoadBalancer) GenerateK8sLoadBalancer() error {
+	qlb, err := lb.opt.LbExecutor.DescribeLoadBalancer(lb.name)
+	if err != nil {
+		return err
+	}
+	lb.lbID = qcservice.StringValue(qlb.LoadBalancerID)
+	lb.Status.K8sLoadBalancerStatus = lb.statusFromQingCloudLB(qlb)
+	return nil
+}
+
+// EnsureQingCloudLB creates the LB if it doesn't exist and reconciles its
+// listeners and security group rules to match opt. An EIP is attached only
+// when the LB is created; an existing LB's EIP is left as it is. The returned
+// error may be an
+// *errors.RetryError (see pkg/errors) when an underlying QingCloud job is
+// still running or the API is rate-limited.
+func (lb *LoadBalancer) EnsureQingCloudLB() error {
+	qlb, err := lb.opt.LbExecutor.DescribeLoadBalancer(lb.name)
+	if err != nil && !errors.IsResourceNotFound(err) {
+		return lb.fail(err)
+	}
+	if qlb == nil {
+		lb.event(v1.EventTypeNormal, "CreatingLoadBalancer", "Creating QingCloud load balancer %s", lb.name)
+		eipID := ""
+		if !lb.opt.Internal {
+			lb.event(v1.EventTypeNormal, "AllocatingEIP", "Allocating an EIP for load balancer %s", lb.name)
+			eip, err := lb.opt.EipHelper.EnsureAttached(lb.name)
+			if err != nil {
+				return lb.fail(err)
+			}
+			eipID = eip.ID
+			lb.event(v1.EventTypeNormal, "AttachingEIP", "Attached EIP %s to load balancer %s", eipID, lb.name)
+		}
+		lbID, err := lb.opt.LbExecutor.CreateLoadBalancer(lb.name, lb.opt.DefaultVxnet, eipID, lb.opt.Internal)
+		if err != nil {
+			return lb.fail(err)
+		}
+		lb.lbID = lbID
+		if qlb, err = lb.opt.LbExecutor.DescribeLoadBalancer(lb.name); err != nil {
+			return lb.fail(err)
+		}
+	} else {
+		lb.lbID = qcservice.StringValue(qlb.LoadBalancerID)
+	}
+
+	lb.event(v1.EventTypeNormal, "UpdatingListeners", "Updating listeners for load balancer %s", lb.name)
+	ports := servicePorts(lb.opt.K8sService)
+	if err := lb.opt.LbExecutor.UpdateListeners(lb.lbID, ports); err != nil {
+		return lb.fail(err)
+	}
+
+	if err := lb.reconcileSecurityGroup(qcservice.StringValue(qlb.SecurityGroupID)); err != nil {
+		return lb.fail(err)
+	}
+
+	lb.Status.K8sLoadBalancerStatus = lb.statusFromQingCloudLB(qlb)
+	lb.event(v1.EventTypeNormal, "EnsuredLoadBalancer", "Ensured load balancer %s", lb.name)
+	return nil
+}
+
+// DeleteQingCloudLB tears down the LB and, for internet-facing LBs, its EIP.
+// It is a no-op (returns nil) if the LB is already gone.
+func (lb *LoadBalancer) DeleteQingCloudLB() error {
+	qlb, err := lb.opt.LbExecutor.DescribeLoadBalancer(lb.name)
+	if err != nil {
+		if errors.IsResourceNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	lb.lbID = qcservice.StringValue(qlb.LoadBalancerID)
+	if !lb.opt.Internal {
+		if err := lb.opt.EipHelper.Release(lb.lbID); err != nil {
+			return lb.fail(err)
+		}
+	}
+	if err := lb.opt.LbExecutor.DeleteLoadBalancer(lb.lbID); err != nil {
+		return lb.fail(err)
+	}
+	lb.event(v1.EventTypeNormal, "DeletedLoadBalancer", "Deleted load balancer %s", lb.name)
+	return nil
+}
+
+// event records a milestone Event against lb.opt.K8sService. It is a no-op
+// if opt.EventRecorder wasn't set.
+func (lb *LoadBalancer) event(eventType, reason, messageFmt string, args ...interface{}) {
+	if lb.opt.EventRecorder == nil {
+		return
+	}
+	lb.opt.EventRecorder.Eventf(lb.opt.K8sService, eventType, reason, messageFmt, args...)
+}
+
+// fail records a Warning event for retryable errors and returns err
+// unchanged, so callers can just `return lb.fail(err)` at each fallible
+// call site.
+func (lb *LoadBalancer) fail(err error) error {
+	if errors.IsRetryError(err) {
+		lb.event(v1.EventTypeWarning, "RetryingLoadBalancer", "Retrying load balancer %s: %v", lb.name, err)
+	}
+	return err
+}
+
+// statusFromQingCloudLB builds the Kubernetes LoadBalancerStatus Ingress
+// entry for qlb: the EIP address for an internet-facing LB, or the private
+// VIP for an internal one.
+func (lb *LoadBalancer) statusFromQingCloudLB(qlb *qcservice.LoadBalancer) *v1.LoadBalancerStatus {
+	ip := qcservice.StringValue(qlb.EIP)
+	if lb.opt.Internal {
+		ip = qcservice.StringValue(qlb.PrivateIP)
+	}
+	return &v1.LoadBalancerStatus{
+		Ingress: []v1.LoadBalancerIngress{{IP: ip}},
+	}
+}
+
+// reconcileSecurityGroup diffs the desired (port, protocol, CIDR) ingress
+// rules for lb.opt.K8sService against sgID's current rules and adds/deletes
+// to match. An empty SourceRanges means "0.0.0.0/0", preserving the
+// no-restriction behavior from before loadBalancerSourceRanges was honored.
+// Only rules this CCM previously added (identified by securityGroupRuleOwner
+// in their description) are ever deleted; anything else on the SG is left
+// alone on the assumption the SG may be shared with other tooling.
+func (lb *LoadBalancer) reconcileSecurityGroup(sgID string) error {
+	if sgID == "" {
+		return nil
+	}
+	ranges := lb.opt.SourceRanges
+	if len(ranges) == 0 {
+		ranges = []string{"0.0.0.0/0"}
+	}
+
+	desired := make(map[string]executor.SecurityGroupRule)
+	for _, p := range lb.opt.K8sService.Spec.Ports {
+		proto := strings.ToLower(string(p.Protocol))
+		if proto == "" {
+			proto = "tcp"
+		}
+		for _, cidr := range ranges {
+			key := securityGroupRuleKey(proto, p.Port, cidr)
+			desired[key] = executor.SecurityGroupRule{CIDR: cidr, Port: p.Port, Protocol: proto, Description: securityGroupRuleOwner}
+		}
+	}
+
+	current, err := lb.opt.SgExecutor.DescribeRules(sgID)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(desired))
+	for _, rule := range current {
+		key := securityGroupRuleKey(rule.Protocol, rule.Port, rule.CIDR)
+		if _, wanted := desired[key]; wanted {
+			seen[key] = true
+			continue
+		}
+		if rule.Description != securityGroupRuleOwner {
+			// Not ours; leave it for whatever added it.
+			continue
+		}
+		if err := lb.opt.SgExecutor.DeleteRule(sgID, rule.ID); err != nil {
+			return err
+		}
+	}
+	for key, rule := range desired {
+		if seen[key] {
+			continue
+		}
+		if err := lb.opt.SgExecutor.AddRule(sgID, rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func securityGroupRuleKey(protocol string, port int32, cidr string) string {
+	return fmt.Sprintf("%s|%d|%s", protocol, port, cidr)
+}
+
+func servicePorts(service *v1.Service) []int32 {
+	ports := make([]int32, 0, len(service.Spec.Ports))
+	for _, p := range service.Spec.Ports {
+		ports = append(ports, p.Port)
+	}
+	return ports
+}
@@ -0,0 +1,134 @@
+package loadbalance
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/yunify/qingcloud-cloud-controller-manager/pkg/executor"
+	"k8s.io/api/core/v1"
+)
+
+// fakeSecurityGroupExecutor is an in-memory executor.SecurityGroupExecutor
+// for exercising reconcileSecurityGroup's diff without a real QC API.
+type fakeSecurityGroupExecutor struct {
+	rules   map[string]executor.SecurityGroupRule
+	nextID  int
+	added   []executor.SecurityGroupRule
+	deleted []string
+}
+
+func newFakeSecurityGroupExecutor(rules ...executor.SecurityGroupRule) *fakeSecurityGroupExecutor {
+	f := &fakeSecurityGroupExecutor{rules: map[string]executor.SecurityGroupRule{}}
+	for _, r := range rules {
+		f.nextID++
+		r.ID = fmt.Sprintf("rule-%d", f.nextID)
+		f.rules[r.ID] = r
+	}
+	return f
+}
+
+func (f *fakeSecurityGroupExecutor) EnableTagService([]string) {}
+
+func (f *fakeSecurityGroupExecutor) DescribeRules(string) ([]executor.SecurityGroupRule, error) {
+	rules := make([]executor.SecurityGroupRule, 0, len(f.rules))
+	for _, r := range f.rules {
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func (f *fakeSecurityGroupExecutor) AddRule(_ string, rule executor.SecurityGroupRule) error {
+	f.nextID++
+	rule.ID = fmt.Sprintf("rule-%d", f.nextID)
+	f.rules[rule.ID] = rule
+	f.added = append(f.added, rule)
+	return nil
+}
+
+func (f *fakeSecurityGroupExecutor) DeleteRule(_, ruleID string) error {
+	delete(f.rules, ruleID)
+	f.deleted = append(f.deleted, ruleID)
+	return nil
+}
+
+func newTestLoadBalancer(sg *fakeSecurityGroupExecutor, sourceRanges []string, ports ...v1.ServicePort) *LoadBalancer {
+	return &LoadBalancer{
+		name: "lb-test",
+		opt: &NewLoadBalancerOption{
+			SgExecutor:   sg,
+			SourceRanges: sourceRanges,
+			K8sService: &v1.Service{
+				Spec: v1.ServiceSpec{Ports: ports},
+			},
+		},
+	}
+}
+
+func TestReconcileSecurityGroupAddsMissingRules(t *testing.T) {
+	sg := newFakeSecurityGroupExecutor()
+	lb := newTestLoadBalancer(sg, nil, v1.ServicePort{Port: 80, Protocol: v1.ProtocolTCP})
+
+	if err := lb.reconcileSecurityGroup("sg-1"); err != nil {
+		t.Fatalf("reconcileSecurityGroup: %v", err)
+	}
+	if len(sg.added) != 1 {
+		t.Fatalf("added = %d rules, want 1", len(sg.added))
+	}
+	got := sg.added[0]
+	if got.Port != 80 || got.Protocol != "tcp" || got.CIDR != "0.0.0.0/0" || got.Description != securityGroupRuleOwner {
+		t.Fatalf("unexpected rule added: %+v", got)
+	}
+}
+
+func TestReconcileSecurityGroupLeavesWantedRulesAlone(t *testing.T) {
+	sg := newFakeSecurityGroupExecutor(executor.SecurityGroupRule{
+		CIDR: "0.0.0.0/0", Port: 80, Protocol: "tcp", Description: securityGroupRuleOwner,
+	})
+	lb := newTestLoadBalancer(sg, nil, v1.ServicePort{Port: 80, Protocol: v1.ProtocolTCP})
+
+	if err := lb.reconcileSecurityGroup("sg-1"); err != nil {
+		t.Fatalf("reconcileSecurityGroup: %v", err)
+	}
+	if len(sg.added) != 0 || len(sg.deleted) != 0 {
+		t.Fatalf("expected no changes, added=%v deleted=%v", sg.added, sg.deleted)
+	}
+}
+
+func TestReconcileSecurityGroupDeletesOnlyOwnedRules(t *testing.T) {
+	sg := newFakeSecurityGroupExecutor(
+		executor.SecurityGroupRule{CIDR: "10.0.0.0/8", Port: 80, Protocol: "tcp", Description: securityGroupRuleOwner},
+		executor.SecurityGroupRule{CIDR: "192.168.0.0/16", Port: 22, Protocol: "tcp", Description: "added-by-someone-else"},
+	)
+	lb := newTestLoadBalancer(sg, []string{"0.0.0.0/0"}, v1.ServicePort{Port: 80, Protocol: v1.ProtocolTCP})
+
+	if err := lb.reconcileSecurityGroup("sg-1"); err != nil {
+		t.Fatalf("reconcileSecurityGroup: %v", err)
+	}
+	if len(sg.deleted) != 1 {
+		t.Fatalf("deleted = %v, want exactly the CCM-owned stale rule", sg.deleted)
+	}
+	for _, r := range sg.rules {
+		if r.Description == "added-by-someone-else" && r.Port == 22 {
+			continue
+		}
+		if r.Description == securityGroupRuleOwner && r.Port == 80 && r.CIDR == "0.0.0.0/0" {
+			continue
+		}
+		t.Fatalf("unexpected surviving rule state: %+v", sg.rules)
+	}
+	if len(sg.added) != 1 || sg.added[0].CIDR != "0.0.0.0/0" {
+		t.Fatalf("expected the desired 0.0.0.0/0:80 rule to be added, got %+v", sg.added)
+	}
+}
+
+func TestReconcileSecurityGroupNoOpWithoutSecurityGroup(t *testing.T) {
+	sg := newFakeSecurityGroupExecutor()
+	lb := newTestLoadBalancer(sg, nil, v1.ServicePort{Port: 80, Protocol: v1.ProtocolTCP})
+
+	if err := lb.reconcileSecurityGroup(""); err != nil {
+		t.Fatalf("reconcileSecurityGroup: %v", err)
+	}
+	if len(sg.added) != 0 || len(sg.deleted) != 0 {
+		t.Fatalf("expected no SgExecutor calls, added=%v deleted=%v", sg.added, sg.deleted)
+	}
+}
@@ -0,0 +1,47 @@
+package qingcloud
+
+import "k8s.io/api/core/v1"
+
+// ServiceAnnotationLoadBalancerExternal, when set to "true" on a Service,
+// tells the CCM that the Service's LoadBalancer is managed by something
+// other than this controller (e.g. a dedicated ingress operator talking to
+// QingCloud directly). EnsureLoadBalancer/UpdateLoadBalancer become no-ops
+// that hand control back to the caller via cloudprovider.ImplementedElsewhere.
+const ServiceAnnotationLoadBalancerExternal = "service.beta.kubernetes.io/qingcloud-load-balancer-external"
+
+// isExternalLoadBalancer reports whether service has opted out of LB
+// management by this CCM in favor of an external controller.
+func isExternalLoadBalancer(service *v1.Service) bool {
+	return service.Annotations[ServiceAnnotationLoadBalancerExternal] == "true"
+}
+
+const (
+	// ServiceAnnotationLoadBalancerType selects the kind of QingCloud LB to
+	// build. The only non-default value today is "internal", which builds an
+	// LB reachable only from the VPC/vxnet, with no EIP attached.
+	ServiceAnnotationLoadBalancerType = "service.beta.kubernetes.io/qingcloud-load-balancer-type"
+
+	// LoadBalancerTypeInternal is the value of ServiceAnnotationLoadBalancerType
+	// that requests an internal-only load balancer.
+	LoadBalancerTypeInternal = "internal"
+
+	// ServiceAnnotationLoadBalancerInternalSubnet selects the private vxnet an
+	// internal load balancer is bound to. When unset, qc.defaultVxNetForLB is used.
+	ServiceAnnotationLoadBalancerInternalSubnet = "service.kubernetes.io/qingcloud-load-balancer-internal-subnet"
+)
+
+// isInternalLoadBalancer reports whether service requests an internal-only
+// (no EIP) load balancer.
+func isInternalLoadBalancer(service *v1.Service) bool {
+	return service.Annotations[ServiceAnnotationLoadBalancerType] == LoadBalancerTypeInternal
+}
+
+// internalLoadBalancerVxnet returns the private vxnet an internal load
+// balancer should bind to, falling back to defaultVxnet when the Service
+// doesn't request a specific one.
+func internalLoadBalancerVxnet(service *v1.Service, defaultVxnet string) string {
+	if vxnet := service.Annotations[ServiceAnnotationLoadBalancerInternalSubnet]; vxnet != "" {
+		return vxnet
+	}
+	return defaultVxnet
+}
@@ -9,7 +9,9 @@ import (
 	"github.com/yunify/qingcloud-cloud-controller-manager/pkg/executor"
 	"github.com/yunify/qingcloud-cloud-controller-manager/pkg/loadbalance"
 	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/cloud-provider"
+	servicehelper "k8s.io/cloud-provider/service/helpers"
 	"k8s.io/klog"
 )
 
@@ -22,22 +24,38 @@ func (qc *QingCloud) newLoadBalance(ctx context.Context, service *v1.Service, no
 		lbExec.EnableTagService(qc.tagIDs)
 		sgExec.EnableTagService(qc.tagIDs)
 	}
-	eipHelper := eip.NewEIPHelperOfQingCloud(eip.NewEIPHelperOfQingCloudOption{
-		JobAPI: qc.jobService,
-		EIPAPI: qc.eipService,
-		UserID: qc.userID,
-	})
+	sourceRanges, err := servicehelper.GetLoadBalancerSourceRanges(service)
+	if err != nil {
+		return nil, err
+	}
+	internal := isInternalLoadBalancer(service)
+	vxnet := qc.defaultVxNetForLB
+	var eipHelper loadbalance.EipHelper
+	if internal {
+		// Internal LBs are bound directly to a private vxnet and never get an
+		// EIP, so there's nothing for eipHelper to allocate/attach/release.
+		vxnet = internalLoadBalancerVxnet(service, qc.defaultVxNetForLB)
+	} else {
+		eipHelper = eip.NewEIPHelperOfQingCloud(eip.NewEIPHelperOfQingCloudOption{
+			JobAPI: qc.jobService,
+			EIPAPI: qc.eipService,
+			UserID: qc.userID,
+		})
+	}
 	opt := &loadbalance.NewLoadBalancerOption{
-		LbExecutor:   lbExec,
-		EipHelper:    eipHelper,
-		SgExecutor:   sgExec,
-		NodeLister:   qc.nodeInformer.Lister(),
-		K8sNodes:     nodes,
-		K8sService:   service,
-		Context:      ctx,
-		ClusterName:  qc.clusterID,
-		SkipCheck:    skipCheck,
-		DefaultVxnet: qc.defaultVxNetForLB,
+		LbExecutor:    lbExec,
+		EipHelper:     eipHelper,
+		SgExecutor:    sgExec,
+		NodeLister:    qc.nodeInformer.Lister(),
+		K8sNodes:      nodes,
+		K8sService:    service,
+		Context:       ctx,
+		ClusterName:   qc.clusterID,
+		SkipCheck:     skipCheck,
+		DefaultVxnet:  vxnet,
+		Internal:      internal,
+		SourceRanges:  sourceRanges.StringSlice(),
+		EventRecorder: qc.eventRecorder,
 	}
 	return loadbalance.NewLoadBalancer(opt)
 }
@@ -53,6 +71,14 @@ func (qc *QingCloud) LoadBalancer() (cloudprovider.LoadBalancer, bool) {
 func (qc *QingCloud) GetLoadBalancer(ctx context.Context, _ string, service *v1.Service) (status *v1.LoadBalancerStatus, exists bool, err error) {
 	patcher := newServicePatcher(qc.corev1interface, service)
 	defer patcher.Patch()
+	if isExternalLoadBalancer(service) {
+		// Ownership lives with an external controller; just report whatever
+		// status is already recorded on the Service.
+		if service.Status.LoadBalancer.Ingress == nil {
+			return nil, true, nil
+		}
+		return service.Status.LoadBalancer.DeepCopy(), true, nil
+	}
 	lb, err := qc.newLoadBalance(ctx, service, nil, false)
 	if err != nil {
 		return nil, false, err
@@ -81,7 +107,18 @@ func (qc *QingCloud) GetLoadBalancerName(_ context.Context, _ string, service *v
 // Implementations must treat the *v1.Service and *v1.Node
 // parameters as read-only and not modify them.
 // Parameter 'clusterName' is the name of the cluster as presented to kube-controller-manager
+//
+// The returned error may be an *errors.RetryError when the underlying
+// QingCloud job is still pending or the API is rate-limited; the service
+// controller honors its RetryAfter instead of its usual exponential backoff.
 func (qc *QingCloud) EnsureLoadBalancer(ctx context.Context, _ string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
+	if isExternalLoadBalancer(service) {
+		klog.V(2).Infof("Service %s/%s is handled by an external load balancer controller, skipping", service.Namespace, service.Name)
+		return nil, cloudprovider.ImplementedElsewhere
+	}
+	key := serviceReconcileKey(service)
+	qc.serviceReconcileLock.LockKey(key)
+	defer qc.serviceReconcileLock.UnlockKey(key)
 	patcher := newServicePatcher(qc.corev1interface, service)
 	defer patcher.Patch()
 	startTime := time.Now()
@@ -108,7 +145,21 @@ func (qc *QingCloud) EnsureLoadBalancer(ctx context.Context, _ string, service *
 // Implementations must treat the *v1.Service and *v1.Node
 // parameters as read-only and not modify them.
 // Parameter 'clusterName' is the name of the cluster as presented to kube-controller-manager
+//
+// The returned error may be an *errors.RetryError; see EnsureLoadBalancer.
 func (qc *QingCloud) UpdateLoadBalancer(ctx context.Context, _ string, service *v1.Service, nodes []*v1.Node) error {
+	if isExternalLoadBalancer(service) {
+		klog.V(2).Infof("Service %s/%s is handled by an external load balancer controller, skipping", service.Namespace, service.Name)
+		return cloudprovider.ImplementedElsewhere
+	}
+	key := serviceReconcileKey(service)
+	qc.serviceReconcileLock.LockKey(key)
+	defer qc.serviceReconcileLock.UnlockKey(key)
+	// The Service handed to us by the service controller can be stale by the
+	// time we get here (e.g. a concurrent node-sync reconcile already ran), so
+	// refresh it from the lister before the patcher snapshots it: the patcher
+	// must diff/persist against the same object the reconciler below mutates.
+	service = qc.refreshServiceFromLister(service)
 	patcher := newServicePatcher(qc.corev1interface, service)
 	defer patcher.Patch()
 	klog.Infof("===============UpdateLoadBalancer for %s", service.Namespace+"/"+service.Name)
@@ -124,6 +175,30 @@ func (qc *QingCloud) UpdateLoadBalancer(ctx context.Context, _ string, service *
 	return lb.EnsureQingCloudLB()
 }
 
+// serviceReconcileKey returns the key serviceReconcileLock serializes
+// reconciles on: the Service's namespace/name, not one key for the whole
+// controller.
+func serviceReconcileKey(service *v1.Service) string {
+	return service.Namespace + "/" + service.Name
+}
+
+// refreshServiceFromLister re-fetches service from the shared informer cache,
+// falling back to the passed-in Service if the lister doesn't have it (e.g.
+// it was deleted, or the lister isn't populated yet).
+func (qc *QingCloud) refreshServiceFromLister(service *v1.Service) *v1.Service {
+	if qc.serviceLister == nil {
+		return service
+	}
+	fresh, err := qc.serviceLister.Services(service.Namespace).Get(service.Name)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			klog.Warningf("Failed to refresh service %s/%s from lister, using passed-in copy: %v", service.Namespace, service.Name, err)
+		}
+		return service
+	}
+	return fresh
+}
+
 // EnsureLoadBalancerDeleted deletes the specified load balancer if it
 // exists, returning nil if the load balancer specified either didn't exist or
 // was successfully deleted.
@@ -133,11 +208,22 @@ func (qc *QingCloud) UpdateLoadBalancer(ctx context.Context, _ string, service *
 // Implementations must treat the *v1.Service parameter as read-only and not modify it.
 // Parameter 'clusterName' is the name of the cluster as presented to kube-controller-manager
 func (qc *QingCloud) EnsureLoadBalancerDeleted(ctx context.Context, _ string, service *v1.Service) error {
+	key := serviceReconcileKey(service)
+	qc.serviceReconcileLock.LockKey(key)
+	defer qc.serviceReconcileLock.UnlockKey(key)
 	startTime := time.Now()
 	defer func() {
 		elapsed := time.Since(startTime)
 		klog.V(1).Infof("DeleteLoadBalancer takes total %d seconds", elapsed/time.Second)
 	}()
 	lb, _ := qc.newLoadBalance(ctx, service, nil, true)
-	return lb.DeleteQingCloudLB()
+	err := lb.DeleteQingCloudLB()
+	if err != nil && isExternalLoadBalancer(service) {
+		// Ownership has moved to an external controller; only tear down
+		// whatever this CCM created earlier on a best-effort basis so we
+		// don't block the Service delete/spec-flip on it.
+		klog.Warningf("Best-effort delete of CCM-managed resources for externally-managed service %s/%s failed: %v", service.Namespace, service.Name, err)
+		return nil
+	}
+	return err
 }
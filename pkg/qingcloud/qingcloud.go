@@ -0,0 +1,67 @@
+package qingcloud
+
+import (
+	qcservice "github.com/yunify/qingcloud-sdk-go/service"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/keymutex"
+	"k8s.io/klog"
+)
+
+// QingCloud is the implementation of cloud provider for QingCloud.
+type QingCloud struct {
+	userID    string
+	clusterID string
+
+	lbService            *qcservice.LoadBalancerService
+	jobService           *qcservice.JobService
+	tagService           *qcservice.TagService
+	eipService           *qcservice.EIPService
+	securityGroupService *qcservice.SecurityGroupService
+
+	tagIDs            []string
+	defaultVxNetForLB string
+
+	corev1interface corev1.CoreV1Interface
+
+	nodeInformer coreinformers.NodeInformer
+
+	// serviceReconcileLock serializes EnsureLoadBalancer/UpdateLoadBalancer/
+	// EnsureLoadBalancerDeleted calls per Service (keyed by namespace/name) so
+	// concurrent reconciles of the same QingCloud LB don't race. Keys are
+	// hashed onto a fixed set of locks, so two unrelated Services whose keys
+	// share a lock also wait on each other.
+	serviceReconcileLock keymutex.KeyMutex
+
+	// serviceLister is used to refresh a Service from the informer cache
+	// right before reconciling its LB, instead of trusting the (possibly
+	// stale) copy handed to us by the service controller.
+	serviceLister corelisters.ServiceLister
+
+	// eventRecorder lets the LB reconciler surface progress and retryable
+	// failures on the Service via `kubectl describe svc` instead of only klog.
+	eventRecorder record.EventRecorder
+}
+
+// SetInformers wires the shared informer factory into the cloud provider so
+// it can build listers for the resources it watches.
+func (qc *QingCloud) SetInformers(informerFactory informers.SharedInformerFactory) {
+	qc.nodeInformer = informerFactory.Core().V1().Nodes()
+	qc.serviceLister = informerFactory.Core().V1().Services().Lister()
+	qc.eventRecorder = qc.newEventRecorder()
+	qc.serviceReconcileLock = keymutex.NewHashed(0)
+}
+
+// newEventRecorder builds an EventRecorder that publishes through
+// qc.corev1interface, the same pattern the upstream service controller uses.
+func (qc *QingCloud) newEventRecorder() record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartLogging(klog.V(4).Infof)
+	broadcaster.StartRecordingToSink(&record.EventSinkImpl{Interface: qc.corev1interface.Events("")})
+	return broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "qingcloud-cloud-controller-manager"})
+}